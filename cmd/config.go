@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/superfly/flyctl/src/flyctl"
+)
+
+func newConfigCommand() *Command {
+	cmd := &Command{
+		Command: &cobra.Command{
+			Use:   "config",
+			Short: "manage app configuration",
+			Long:  "Convert the fly.toml/fly.yaml/fly.json config file for an app to another format.",
+		},
+	}
+
+	convert := BuildCommand(cmd, runConfigConvert, "convert", "convert the app config to another format", os.Stdout, true)
+	convert.AddStringFlag(StringFlagOpts{
+		Name:        "to",
+		Description: "format to convert the config file to: toml, json, or yaml",
+	})
+
+	return cmd
+}
+
+var configFormatsByName = map[string]flyctl.ConfigFormat{
+	"toml": flyctl.TOMLFormat,
+	"json": flyctl.JSONFormat,
+	"yaml": flyctl.YAMLFormat,
+	"yml":  flyctl.YAMLFormat,
+}
+
+func runConfigConvert(ctx *CmdContext) error {
+	to, _ := ctx.Config.GetString("to")
+	if to == "" {
+		return fmt.Errorf("--to is required (toml, json, or yaml)")
+	}
+
+	format, ok := configFormatsByName[to]
+	if !ok {
+		return fmt.Errorf("unknown format %q, expected toml, json, or yaml", to)
+	}
+
+	sourcePath, err := flyctl.ResolveConfigFileFromPath(ctx.WorkingDir)
+	if err != nil {
+		return err
+	}
+
+	appConfig, err := flyctl.LoadAppConfig(sourcePath, nil)
+	if err != nil {
+		return err
+	}
+
+	destPath := sourcePath[:len(sourcePath)-len(flyctl.ConfigFormatFromPath(sourcePath))] + string(format)
+
+	if err := appConfig.WriteToFile(destPath); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %s\n", destPath)
+
+	return nil
+}
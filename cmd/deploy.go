@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/docker"
+	"github.com/superfly/flyctl/src/flyctl"
+)
+
+func newDeployCommand() *Command {
+	cmd := BuildCommand(nil, runDeploy, "deploy", "deploy the app", os.Stdout, true)
+	cmd.AddStringFlag(StringFlagOpts{
+		Name:        "config",
+		Shorthand:   "c",
+		Description: "path to the app config file, defaults to fly.toml/fly.yaml/fly.json in the working directory",
+	})
+	cmd.AddStringFlag(StringFlagOpts{
+		Name:        "image",
+		Shorthand:   "i",
+		Description: "deploy this existing image instead of building from source",
+	})
+	cmd.Command.Flags().StringArray("var", nil, "set a fly.toml template variable as NAME=VALUE, for \"${NAME}\" interpolation; can be repeated")
+
+	cmd.AddBoolFlag(BoolFlagOpts{
+		Name:        "local-only",
+		Description: "only build locally, using the local Docker/BuildKit daemon",
+	})
+	cmd.AddBoolFlag(BoolFlagOpts{
+		Name:        "remote-only",
+		Description: "only build remotely, using the Fly builder",
+	})
+	cmd.AddStringFlag(StringFlagOpts{
+		Name:        "target",
+		Description: "the Dockerfile build target to build, overriding [build] target in the app config",
+	})
+	cmd.Command.Flags().StringArray("build-arg", nil, "set a build argument as NAME=VALUE, passed through to the builder; can be repeated")
+
+	return cmd
+}
+
+func runDeploy(ctx *CmdContext) error {
+	configPath, _ := ctx.Config.GetString("config")
+	if configPath == "" {
+		resolved, err := flyctl.ResolveConfigFileFromPath(ctx.WorkingDir)
+		if err != nil {
+			return err
+		}
+		configPath = resolved
+	}
+
+	vars, err := parseKeyValueFlags(ctx.Config.GetStringSlice("var"))
+	if err != nil {
+		return err
+	}
+
+	appConfig, err := flyctl.LoadAppConfig(configPath, vars)
+	if err != nil {
+		return err
+	}
+
+	buildArgs, err := parseKeyValueFlags(ctx.Config.GetStringSlice("build-arg"))
+	if err != nil {
+		return err
+	}
+	target, _ := ctx.Config.GetString("target")
+
+	buildOpts := docker.DeployOperationOptions{
+		LocalOnly:  ctx.Config.GetBool("local-only"),
+		RemoteOnly: ctx.Config.GetBool("remote-only"),
+		BuildArgs:  buildArgs,
+		Target:     target,
+	}
+
+	op, err := docker.NewDeployOperation(context.Background(), "", appConfig, ctx.FlyClient, os.Stdout, false, buildOpts)
+	if err != nil {
+		return err
+	}
+
+	imageRef, _ := ctx.Config.GetString("image")
+
+	var release *api.Release
+	if imageRef != "" {
+		release, err = op.DeployImage(imageRef)
+	} else {
+		release, err = op.BuildAndDeploy(ctx.WorkingDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Release", release.Version, "deployed")
+
+	return nil
+}
+
+// parseKeyValueFlags turns repeated "NAME=VALUE" flag values (from --var or
+// --build-arg) into a map, for flyctl.LoadAppConfig's template interpolation
+// and DeployOperationOptions.BuildArgs respectively.
+func parseKeyValueFlags(raw []string) (map[string]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	vars := make(map[string]string, len(raw))
+	for _, kv := range raw {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid %q, expected NAME=VALUE", kv)
+		}
+		vars[name] = value
+	}
+
+	return vars, nil
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/superfly/flyctl/docker"
+)
+
+func newImageCommand() *Command {
+	cmd := &Command{
+		Command: &cobra.Command{
+			Use:   "image",
+			Short: "manage app images",
+			Long:  "Commands for working with app images directly, outside of a normal deploy.",
+		},
+	}
+
+	manifest := &Command{
+		Command: &cobra.Command{
+			Use:   "manifest",
+			Short: "manage multi-arch image manifests",
+			Long:  "Build a multi-arch manifest list/image index out of band, mirroring `podman manifest`.",
+		},
+	}
+	cmd.Command.AddCommand(manifest.Command)
+
+	create := BuildCommand(manifest, runManifestCreate, "create", "create a new, empty manifest list", os.Stdout, true)
+	create.Command.Args = cobra.ExactArgs(1)
+
+	add := BuildCommand(manifest, runManifestAdd, "add", "add an image to a manifest list", os.Stdout, true)
+	add.Command.Args = cobra.ExactArgs(2)
+
+	push := BuildCommand(manifest, runManifestPush, "push", "push a manifest list to the registry", os.Stdout, true)
+	push.Command.Args = cobra.ExactArgs(1)
+
+	return cmd
+}
+
+func runManifestCreate(ctx *CmdContext) error {
+	tag := ctx.Args[0]
+
+	builder, err := docker.NewManifestBuilder(tag)
+	if err != nil {
+		return err
+	}
+	if err := builder.Create(); err != nil {
+		return err
+	}
+
+	fmt.Println("Created manifest list", tag)
+
+	return nil
+}
+
+func runManifestAdd(ctx *CmdContext) error {
+	tag, imageRef := ctx.Args[0], ctx.Args[1]
+
+	builder, err := docker.NewManifestBuilder(tag)
+	if err != nil {
+		return err
+	}
+
+	if err := builder.Add(imageRef); err != nil {
+		return err
+	}
+
+	fmt.Println("Added", imageRef, "to", tag)
+
+	return nil
+}
+
+func runManifestPush(ctx *CmdContext) error {
+	tag := ctx.Args[0]
+
+	builder, err := docker.NewManifestBuilder(tag)
+	if err != nil {
+		return err
+	}
+
+	digest, err := builder.Push()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("-->", digest)
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/superfly/flyctl/flyctl"
+)
+
+// registryHost extracts the registry hostname from an image reference
+// (e.g. "ghcr.io/acme/app:latest" -> "ghcr.io"), for looking up credentials.
+func registryHost(imageRef string) string {
+	ref, err := name.ParseReference(imageRef)
+	if err != nil {
+		return ""
+	}
+	return ref.Context().RegistryStr()
+}
+
+// RegistryAuthConfig is the resolved credential for one registry host,
+// usable either as Docker basic auth (Username/Password) or a bearer
+// identity token, mirroring docker/podman's AuthConfig.
+type RegistryAuthConfig struct {
+	Username      string
+	Password      string
+	IdentityToken string
+}
+
+func (c RegistryAuthConfig) empty() bool {
+	return c.Username == "" && c.Password == "" && c.IdentityToken == ""
+}
+
+// Authenticator adapts a RegistryAuthConfig to go-containerregistry's
+// authn.Authenticator, for use with remote.WithAuth when pulling/pushing
+// through the go-containerregistry transport (e.g. ManifestBuilder).
+// checkManifest and optimizeImage take the encoded token from
+// resolveAuthToken instead.
+func (c RegistryAuthConfig) Authenticator() authn.Authenticator {
+	if c.IdentityToken != "" {
+		return &authn.Bearer{Token: c.IdentityToken}
+	}
+	return &authn.Basic{Username: c.Username, Password: c.Password}
+}
+
+// dockerConfigFile is the subset of Docker/Podman's ~/.docker/config.json
+// (and our own ~/.flyctl/registry-auth.json, which uses the same shape) that
+// we need: per-registry basic auth plus credential helper delegation.
+type dockerConfigFile struct {
+	Auths       map[string]dockerConfigAuth `json:"auths"`
+	CredHelpers map[string]string           `json:"credHelpers,omitempty"`
+}
+
+type dockerConfigAuth struct {
+	Auth          string `json:"auth,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
+
+// AuthResolver resolves registry credentials the same way the Docker CLI
+// does, checking in order: (1) the app's own [registry] config, (2) the
+// flyctl credential store at ~/.flyctl/registry-auth.json, (3)
+// $DOCKER_CONFIG or ~/.docker/config.json, and (4) a docker-credential-*
+// helper binary, invoked over stdio.
+type AuthResolver struct {
+	appConfig *flyctl.AppConfig
+}
+
+func NewAuthResolver(appConfig *flyctl.AppConfig) *AuthResolver {
+	return &AuthResolver{appConfig: appConfig}
+}
+
+// Resolve returns credentials for host (e.g. "ghcr.io"), trying each source
+// in turn and returning the first non-empty result. It's not an error for
+// no source to have credentials for host; callers should treat an empty
+// result as "pull/push anonymously".
+func (r *AuthResolver) Resolve(host string) (RegistryAuthConfig, error) {
+	if cfg := r.fromAppConfig(host); !cfg.empty() {
+		return cfg, nil
+	}
+
+	if cfg, err := r.fromConfigFile(flyctlRegistryAuthPath(), host); err != nil {
+		return RegistryAuthConfig{}, err
+	} else if !cfg.empty() {
+		return cfg, nil
+	}
+
+	if cfg, err := r.fromConfigFile(dockerConfigPath(), host); err != nil {
+		return RegistryAuthConfig{}, err
+	} else if !cfg.empty() {
+		return cfg, nil
+	}
+
+	if cfg, err := r.fromCredentialHelper(dockerConfigPath(), host); err != nil {
+		return RegistryAuthConfig{}, err
+	} else if !cfg.empty() {
+		return cfg, nil
+	}
+
+	return RegistryAuthConfig{}, nil
+}
+
+// fromAppConfig resolves credentials declared in fly.toml's [registry]
+// table. The password/identity token are never stored in fly.toml itself,
+// only the name of the environment variable holding them.
+func (r *AuthResolver) fromAppConfig(host string) RegistryAuthConfig {
+	reg := r.appConfig.Registry
+	if reg == nil || !hostMatches(reg.URL, host) {
+		return RegistryAuthConfig{}
+	}
+
+	if reg.IdentityTokenEnv != "" {
+		return RegistryAuthConfig{IdentityToken: os.Getenv(reg.IdentityTokenEnv)}
+	}
+
+	return RegistryAuthConfig{
+		Username: reg.Username,
+		Password: os.Getenv(reg.PasswordEnv),
+	}
+}
+
+func (r *AuthResolver) fromConfigFile(path, host string) (RegistryAuthConfig, error) {
+	cfg, err := readDockerConfigFile(path)
+	if err != nil {
+		return RegistryAuthConfig{}, err
+	}
+	if cfg == nil {
+		return RegistryAuthConfig{}, nil
+	}
+
+	for server, auth := range cfg.Auths {
+		if !hostMatches(server, host) {
+			continue
+		}
+
+		if auth.IdentityToken != "" {
+			return RegistryAuthConfig{IdentityToken: auth.IdentityToken}, nil
+		}
+		if auth.Auth != "" {
+			username, password, err := decodeBasicAuth(auth.Auth)
+			if err != nil {
+				return RegistryAuthConfig{}, err
+			}
+			return RegistryAuthConfig{Username: username, Password: password}, nil
+		}
+	}
+
+	return RegistryAuthConfig{}, nil
+}
+
+// fromCredentialHelper invokes a docker-credential-<suffix> binary over
+// stdio exactly like the Docker CLI does: run it with the "get" argument,
+// write the server host to its stdin, and parse {ServerURL, Username,
+// Secret} JSON from its stdout.
+func (r *AuthResolver) fromCredentialHelper(configPath, host string) (RegistryAuthConfig, error) {
+	cfg, err := readDockerConfigFile(configPath)
+	if err != nil || cfg == nil {
+		return RegistryAuthConfig{}, err
+	}
+
+	var helper string
+	for server, h := range cfg.CredHelpers {
+		if hostMatches(server, host) {
+			helper = h
+			break
+		}
+	}
+	if helper == "" {
+		return RegistryAuthConfig{}, nil
+	}
+
+	bin := "docker-credential-" + helper
+	cmd := exec.Command(bin, "get")
+	cmd.Stdin = strings.NewReader(host)
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	if err := cmd.Run(); err != nil {
+		return RegistryAuthConfig{}, fmt.Errorf("%s get: %w", bin, err)
+	}
+
+	var resp struct {
+		ServerURL string
+		Username  string
+		Secret    string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return RegistryAuthConfig{}, fmt.Errorf("%s returned invalid JSON: %w", bin, err)
+	}
+
+	return RegistryAuthConfig{Username: resp.Username, Password: resp.Secret}, nil
+}
+
+func readDockerConfigFile(path string) (*dockerConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var cfg dockerConfigFile
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+func decodeBasicAuth(encoded string) (username, password string, err error) {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", err
+	}
+
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid auth encoding")
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// flyctlRegistryAuthPath is ~/.flyctl/registry-auth.json, flyctl's own
+// credential store for registries it doesn't manage itself.
+func flyctlRegistryAuthPath() string {
+	return filepath.Join(flyctlHomeDir(), ".flyctl", "registry-auth.json")
+}
+
+// flyctlHomeDir resolves the user's home directory, falling back to
+// os/user when $HOME isn't set (e.g. running under a minimal init system).
+func flyctlHomeDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		if u, uerr := user.Current(); uerr == nil {
+			home = u.HomeDir
+		}
+	}
+	return home
+}
+
+// dockerConfigPath honors $DOCKER_CONFIG like the Docker CLI, falling back
+// to ~/.docker/config.json.
+func dockerConfigPath() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+// hostMatches compares a registry URL/host from config (which may include a
+// scheme, e.g. "https://ghcr.io") against a bare host.
+func hostMatches(configured, host string) bool {
+	configured = strings.TrimPrefix(configured, "https://")
+	configured = strings.TrimPrefix(configured, "http://")
+	configured = strings.TrimSuffix(configured, "/")
+	return configured == host
+}
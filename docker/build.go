@@ -0,0 +1,196 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/builder/dockerignore"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/flyctl"
+)
+
+// BuildAndDeploy builds contextDir with the backend selected by
+// appConfig.Build.Builder (see ImageBuilder), pushes the result to the Fly
+// registry (or to the [registry] host, when one is configured), and deploys
+// it. It's the entry point for deploys that build
+// from source rather than an existing --image.
+//
+// Building from source only works through the local Docker/BuildKit
+// pipeline today — there's no remote-builder equivalent of ImageBuilder yet
+// — so this honors useLocalBuild() up front and fails loudly rather than
+// building locally regardless and then silently dropping --remote-only/
+// strategy=remote once DeployImage re-checks the strategy.
+func (op *DeployOperation) BuildAndDeploy(contextDir string) (*api.Release, error) {
+	if !op.useLocalBuild() {
+		return nil, fmt.Errorf("building from source with build strategy %q is not supported yet; pass --local-only, or build and push the image yourself and deploy it with --image", op.buildStrategy())
+	}
+
+	imageTag, err := op.builder.Build(op.ctx, op.appConfig, contextDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return op.DeployImage(imageTag)
+}
+
+// buildImageLocally runs the classic `docker build` flow: tar up the build
+// context (honoring .dockerignore), stream it to the local daemon or a
+// BuildKit endpoint, stream the build output through op.out, and tag the
+// resulting image so the rest of the deploy pipeline (pushImage,
+// optimizeImage, deployImage) can pick it up. It backs dockerfileBuilder.
+func (op *DeployOperation) buildImageLocally(contextDir, dockerfilePath string) (string, error) {
+	printHeader("Building image")
+
+	excludes, err := readDockerignore(contextDir)
+	if err != nil {
+		return "", err
+	}
+
+	relDockerfile, err := filepath.Rel(contextDir, dockerfilePath)
+	if err != nil {
+		relDockerfile = dockerfilePath
+	}
+
+	buildArgs := mergeBuildArgs(op.appConfig.Build, op.buildOpts.BuildArgs)
+	target := op.buildOpts.Target
+	if target == "" && op.appConfig.Build != nil {
+		target = op.appConfig.Build.Target
+	}
+
+	if op.appConfig.Build != nil && len(op.appConfig.Build.Platforms) > 1 {
+		return op.buildMultiArchImage(contextDir, relDockerfile, target, buildArgs, op.appConfig.Build.Platforms)
+	}
+
+	imageTag := newDeploymentTag(op.appConfig.AppName)
+
+	if useBuildKit() {
+		if err := op.buildWithBuildKit(contextDir, relDockerfile, imageTag, target, buildArgs); err != nil {
+			return "", err
+		}
+		return imageTag, nil
+	}
+
+	buildCtx, err := archive.TarWithOptions(contextDir, &archive.TarOptions{
+		ExcludePatterns: excludes,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error building context: %w", err)
+	}
+	defer buildCtx.Close()
+
+	opts := types.ImageBuildOptions{
+		Tags:       []string{imageTag},
+		Dockerfile: relDockerfile,
+		BuildArgs:  toBuildArgPointers(buildArgs),
+		Target:     target,
+	}
+	if op.appConfig.Build != nil && op.appConfig.Build.CacheFrom != "" {
+		opts.CacheFrom = []string{op.appConfig.Build.CacheFrom}
+	}
+
+	output, err := op.dockerClient.BuildImage(op.ctx, buildCtx, opts)
+	if err != nil {
+		return "", err
+	}
+	defer output.Close()
+
+	if err := jsonmessage.DisplayJSONMessagesStream(output, op.out, 0, false, nil); err != nil {
+		return "", err
+	}
+
+	fmt.Println("-->", imageTag)
+
+	return imageTag, nil
+}
+
+// buildWithBuildKit shells out to `buildctl` (the BuildKit CLI), the same
+// approach the Docker CLI itself takes when DOCKER_BUILDKIT=1, streaming
+// build output through op.out.
+func (op *DeployOperation) buildWithBuildKit(contextDir, dockerfilePath, imageTag, target string, buildArgs map[string]string) error {
+	args := []string{
+		"build",
+		"--frontend", "dockerfile.v0",
+		"--local", "context=" + contextDir,
+		"--local", "dockerfile=" + filepath.Join(contextDir, filepath.Dir(dockerfilePath)),
+		"--output", fmt.Sprintf("type=docker,name=%s", imageTag),
+	}
+
+	if target != "" {
+		args = append(args, "--opt", "target="+target)
+	}
+	if op.appConfig.Build != nil && op.appConfig.Build.CacheFrom != "" {
+		args = append(args, "--import-cache", "type=registry,ref="+op.appConfig.Build.CacheFrom)
+	}
+	if op.appConfig.Build != nil && op.appConfig.Build.CacheTo != "" {
+		args = append(args, "--export-cache", "type=registry,ref="+op.appConfig.Build.CacheTo)
+	}
+	for k, v := range buildArgs {
+		args = append(args, "--opt", fmt.Sprintf("build-arg:%s=%s", k, v))
+	}
+
+	cmd := exec.CommandContext(op.ctx, "buildctl", args...)
+	cmd.Stdout = op.out
+	cmd.Stderr = op.out
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("buildctl build failed: %w", err)
+	}
+
+	return nil
+}
+
+// useBuildKit reports whether BuildKit should be used for local builds,
+// mirroring the Docker CLI's own DOCKER_BUILDKIT environment toggle.
+func useBuildKit() bool {
+	return os.Getenv("DOCKER_BUILDKIT") == "1"
+}
+
+// HasDockerfile reports whether contextDir contains a Dockerfile, so
+// `flyctl launch` can decide whether to offer buildpack detection.
+func HasDockerfile(contextDir string) bool {
+	_, err := os.Stat(filepath.Join(contextDir, "Dockerfile"))
+	return err == nil
+}
+
+// readDockerignore loads the exclude patterns from contextDir/.dockerignore,
+// returning an empty list if the file doesn't exist.
+func readDockerignore(contextDir string) ([]string, error) {
+	f, err := os.Open(filepath.Join(contextDir, ".dockerignore"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return dockerignore.ReadAll(f)
+}
+
+// mergeBuildArgs layers flag-provided build args over the ones declared in
+// fly.toml, with flags taking precedence.
+func mergeBuildArgs(build *flyctl.Build, overrides map[string]string) map[string]string {
+	args := map[string]string{}
+	if build != nil {
+		for k, v := range build.Args {
+			args[k] = v
+		}
+	}
+	for k, v := range overrides {
+		args[k] = v
+	}
+	return args
+}
+
+func toBuildArgPointers(args map[string]string) map[string]*string {
+	out := make(map[string]*string, len(args))
+	for k, v := range args {
+		v := v
+		out[k] = &v
+	}
+	return out
+}
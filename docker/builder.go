@@ -0,0 +1,126 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	pack "github.com/buildpacks/pack"
+	"github.com/containers/buildah/imagebuildah"
+	"github.com/containers/storage"
+	"github.com/superfly/flyctl/flyctl"
+)
+
+// ImageBuilder produces a locally-available image from an app's source and
+// returns the image reference, leaving pushing/deploying to the rest of the
+// DeployOperation pipeline. appConfig.Build.Builder selects which
+// implementation NewDeployOperation wires up.
+type ImageBuilder interface {
+	Name() string
+	Build(ctx context.Context, appConfig *flyctl.AppConfig, contextDir string) (imageRef string, err error)
+}
+
+// builderFor resolves appConfig.Build.Builder to a concrete ImageBuilder:
+//   - "", "dockerfile" -> dockerfileBuilder (current behavior)
+//   - "paketo/*", "heroku/*" -> buildpackBuilder, using the rest of the
+//     string as the buildpack builder image
+//   - "buildah" -> buildahBuilder
+//
+// An unrecognized value is an error rather than a silent fallback to
+// dockerfileBuilder, so a typo in [build] builder fails fast instead of
+// building with the wrong backend and failing later with a confusing
+// "missing Dockerfile" error.
+func (op *DeployOperation) builderFor(name string) (ImageBuilder, error) {
+	switch {
+	case name == "" || name == "dockerfile":
+		return &dockerfileBuilder{op: op}, nil
+	case strings.HasPrefix(name, "paketo/") || strings.HasPrefix(name, "heroku/"):
+		return &buildpackBuilder{op: op, builderImage: strings.SplitN(name, "/", 2)[1]}, nil
+	case name == "buildah":
+		return &buildahBuilder{op: op}, nil
+	default:
+		return nil, fmt.Errorf("unknown builder %q, expected \"dockerfile\", \"buildah\", or \"paketo/*\"/\"heroku/*\"", name)
+	}
+}
+
+// dockerfileBuilder is the original behavior: build a Dockerfile with the
+// local Docker daemon or BuildKit.
+type dockerfileBuilder struct {
+	op *DeployOperation
+}
+
+func (b *dockerfileBuilder) Name() string { return "dockerfile" }
+
+func (b *dockerfileBuilder) Build(ctx context.Context, appConfig *flyctl.AppConfig, contextDir string) (string, error) {
+	return b.op.buildImageLocally(contextDir, filepath.Join(contextDir, "Dockerfile"))
+}
+
+// buildpackBuilder produces an OCI image straight from source, with no
+// Dockerfile, using Cloud Native Buildpacks' pack library.
+type buildpackBuilder struct {
+	op           *DeployOperation
+	builderImage string
+}
+
+func (b *buildpackBuilder) Name() string { return "buildpacks" }
+
+func (b *buildpackBuilder) Build(ctx context.Context, appConfig *flyctl.AppConfig, contextDir string) (string, error) {
+	printHeader("Building image with Cloud Native Buildpacks")
+
+	imageTag := newDeploymentTag(appConfig.AppName)
+
+	client, err := pack.NewClient()
+	if err != nil {
+		return "", err
+	}
+
+	if err := client.Build(ctx, pack.BuildOptions{
+		Image:   imageTag,
+		Builder: b.builderImage,
+		AppPath: contextDir,
+		Env:     mergeBuildArgs(appConfig.Build, b.op.buildOpts.BuildArgs),
+	}); err != nil {
+		return "", fmt.Errorf("buildpack build failed: %w", err)
+	}
+
+	fmt.Println("-->", imageTag)
+
+	return imageTag, nil
+}
+
+// buildahBuilder runs a Dockerfile build through the Buildah Go API instead
+// of a Docker daemon, for rootless/CI environments that don't have one.
+type buildahBuilder struct {
+	op *DeployOperation
+}
+
+func (b *buildahBuilder) Name() string { return "buildah" }
+
+func (b *buildahBuilder) Build(ctx context.Context, appConfig *flyctl.AppConfig, contextDir string) (string, error) {
+	printHeader("Building image with Buildah")
+
+	imageTag := newDeploymentTag(appConfig.AppName)
+
+	store, err := storage.GetStore(storage.StoreOptions{})
+	if err != nil {
+		return "", fmt.Errorf("could not open container storage: %w", err)
+	}
+	defer store.Shutdown(false)
+
+	options := imagebuildah.BuildOptions{
+		Output:           imageTag,
+		ContextDirectory: contextDir,
+		Args:             mergeBuildArgs(appConfig.Build, b.op.buildOpts.BuildArgs),
+		Out:              b.op.out,
+		Err:              b.op.out,
+	}
+
+	if _, _, err := imagebuildah.BuildDockerfiles(ctx, store, options, "Dockerfile"); err != nil {
+		return "", fmt.Errorf("buildah build failed: %w", err)
+	}
+
+	fmt.Println("-->", imageTag)
+
+	return imageTag, nil
+}
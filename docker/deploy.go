@@ -1,13 +1,16 @@
 package docker
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/briandowns/spinner"
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/logrusorgru/aurora"
 	"github.com/mattn/go-isatty"
 	"github.com/superfly/flyctl/api"
@@ -25,9 +28,38 @@ type DeployOperation struct {
 	appName         string
 	appConfig       *flyctl.AppConfig
 	squash          bool
+	buildOpts       DeployOperationOptions
+	builder         ImageBuilder
+	stepResults     []*api.ReleaseStepResult
+
+	// multiArchRef/multiArchDigest, when set, are the manifest list tag and
+	// digest returned by a multi-platform build; the tag is already pushed
+	// to the registry, so DeployImage skips the single-image
+	// resolve/tag/push path, and deployImage sends the digest (not the tag)
+	// to the API as the deployment reference.
+	multiArchRef    string
+	multiArchDigest string
 }
 
-func NewDeployOperation(ctx context.Context, appName string, appConfig *flyctl.AppConfig, apiClient *api.Client, out io.Writer, squash bool) (*DeployOperation, error) {
+// DeployOperationOptions carries the optional, build-related knobs that come
+// from CLI flags on `deploy`/`launch` rather than from the app itself. The
+// zero value selects the existing default behavior (auto strategy, no
+// overrides).
+type DeployOperationOptions struct {
+	// LocalOnly/RemoteOnly force the build strategy regardless of
+	// [build] strategy in fly.toml, mirroring --local-only/--remote-only.
+	LocalOnly  bool
+	RemoteOnly bool
+
+	// BuildArgs are merged over appConfig.Build.Args, with these taking
+	// precedence, from repeated --build-arg flags.
+	BuildArgs map[string]string
+
+	// Target overrides appConfig.Build.Target when set, from --target.
+	Target string
+}
+
+func NewDeployOperation(ctx context.Context, appName string, appConfig *flyctl.AppConfig, apiClient *api.Client, out io.Writer, squash bool, buildOpts DeployOperationOptions) (*DeployOperation, error) {
 	dockerClient, err := NewDockerClient()
 	if err != nil {
 		return nil, err
@@ -41,10 +73,21 @@ func NewDeployOperation(ctx context.Context, appName string, appConfig *flyctl.A
 		appName:      appName,
 		appConfig:    appConfig,
 		squash:       squash,
+		buildOpts:    buildOpts,
 	}
 
 	op.dockerAvailable = op.dockerClient.Check(ctx) == nil
 
+	builderName := ""
+	if appConfig != nil && appConfig.Build != nil {
+		builderName = appConfig.Build.Builder
+	}
+	builder, err := op.builderFor(builderName)
+	if err != nil {
+		return nil, err
+	}
+	op.builder = builder
+
 	return op, nil
 }
 
@@ -60,12 +103,73 @@ func (op *DeployOperation) DockerAvailable() bool {
 }
 
 func (op *DeployOperation) DeployImage(imageRef string) (*api.Release, error) {
-	//if op.dockerAvailable {
-	//	return op.deployImageWithDocker(imageRef)
-	//}
+	if op.multiArchRef != "" && imageRef == op.multiArchRef {
+		return op.deployPushedImage(imageRef)
+	}
+	if op.useLocalBuild() {
+		return op.deployImageWithDocker(imageRef)
+	}
 	return op.deployImageWithoutDocker(imageRef)
 }
 
+// deployPushedImage deploys imageRef without resolving/tagging/pushing it
+// first, for images (like a just-assembled multi-arch manifest list) that
+// are already in the registry.
+func (op *DeployOperation) deployPushedImage(imageRef string) (*api.Release, error) {
+	if err := op.runPreDeploySteps(imageRef); err != nil {
+		return nil, err
+	}
+
+	authToken, err := op.resolveAuthToken(imageRef)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := op.optimizeImage(imageRef, authToken); err != nil {
+		return nil, err
+	}
+
+	release, err := op.deployImage(imageRef)
+	if err != nil {
+		return nil, err
+	}
+
+	op.runPostDeploySteps(imageRef)
+
+	return release, nil
+}
+
+// buildStrategy resolves the effective build strategy ("local", "remote", or
+// "auto") from, in order of precedence: the --local-only/--remote-only
+// flags, then [build] strategy in fly.toml, defaulting to "auto".
+func (op *DeployOperation) buildStrategy() string {
+	switch {
+	case op.buildOpts.LocalOnly:
+		return "local"
+	case op.buildOpts.RemoteOnly:
+		return "remote"
+	}
+
+	if op.appConfig != nil && op.appConfig.Build != nil && op.appConfig.Build.Strategy != "" {
+		return op.appConfig.Build.Strategy
+	}
+
+	return "auto"
+}
+
+// useLocalBuild reports whether the deploy should go through the local
+// Docker/BuildKit pipeline rather than the Fly remote optimizer.
+func (op *DeployOperation) useLocalBuild() bool {
+	switch op.buildStrategy() {
+	case "local":
+		return true
+	case "remote":
+		return false
+	default: // "auto"
+		return op.dockerAvailable
+	}
+}
+
 func (op *DeployOperation) ValidateConfig() (*api.AppConfig, error) {
 	if op.appConfig == nil {
 		op.appConfig = flyctl.NewAppConfig()
@@ -90,6 +194,10 @@ func (op *DeployOperation) ValidateConfig() (*api.AppConfig, error) {
 }
 
 func (op *DeployOperation) deployImageWithDocker(imageRef string) (*api.Release, error) {
+	if err := op.runPreDeploySteps(imageRef); err != nil {
+		return nil, err
+	}
+
 	deploymentTag, err := op.resolveAndTagImageRef(imageRef)
 	if err != nil {
 		return nil, err
@@ -99,7 +207,12 @@ func (op *DeployOperation) deployImageWithDocker(imageRef string) (*api.Release,
 		return nil, err
 	}
 
-	if err := op.optimizeImage(deploymentTag); err != nil {
+	authToken, err := op.resolveAuthToken(deploymentTag)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := op.optimizeImage(deploymentTag, authToken); err != nil {
 		return nil, err
 	}
 
@@ -108,6 +221,8 @@ func (op *DeployOperation) deployImageWithDocker(imageRef string) (*api.Release,
 		return nil, err
 	}
 
+	op.runPostDeploySteps(deploymentTag)
+
 	op.cleanDeploymentTags()
 
 	return release, nil
@@ -115,16 +230,71 @@ func (op *DeployOperation) deployImageWithDocker(imageRef string) (*api.Release,
 }
 
 func (op *DeployOperation) deployImageWithoutDocker(imageRef string) (*api.Release, error) {
-	ref, err := checkManifest(op.ctx, imageRef, "")
+	if err := op.runPreDeploySteps(imageRef); err != nil {
+		return nil, err
+	}
+
+	authToken, err := op.resolveAuthToken(imageRef)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := op.optimizeImage(ref.Remote()); err != nil {
+	ref, err := checkManifest(op.ctx, imageRef, authToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := op.optimizeImage(ref.Remote(), authToken); err != nil {
+		return nil, err
+	}
+
+	release, err := op.deployImage(ref.Remote())
+	if err != nil {
 		return nil, err
 	}
 
-	return op.deployImage(ref.Remote())
+	op.runPostDeploySteps(ref.Remote())
+
+	return release, nil
+}
+
+// resolveAuthToken resolves credentials for imageRef's registry and encodes
+// them the way checkManifest/optimizeImage expect: an identity token as-is,
+// or a "username:password" pair base64-encoded like Docker's basic auth
+// header, so private base images can be pulled during remote optimization.
+func (op *DeployOperation) resolveAuthToken(imageRef string) (string, error) {
+	auth, err := NewAuthResolver(op.appConfig).Resolve(registryHost(imageRef))
+	if err != nil {
+		return "", err
+	}
+
+	if auth.IdentityToken != "" {
+		return auth.IdentityToken, nil
+	}
+	if auth.Username != "" {
+		return base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password)), nil
+	}
+
+	return "", nil
+}
+
+// runPreDeploySteps runs the "pre" and "release" deploy.steps against
+// imageRef, in that order, failing the deploy if either phase fails —
+// mirroring how a release-phase migration should block a rollout.
+func (op *DeployOperation) runPreDeploySteps(imageRef string) error {
+	if err := op.RunSteps("pre", imageRef); err != nil {
+		return err
+	}
+	return op.RunSteps("release", imageRef)
+}
+
+// runPostDeploySteps runs the "post" deploy.steps against imageRef. The
+// release is already live at this point, so a failing post step is logged
+// rather than failing the deploy.
+func (op *DeployOperation) runPostDeploySteps(imageRef string) {
+	if err := op.RunSteps("post", imageRef); err != nil {
+		terminal.Debug("post-deploy step failed", err)
+	}
 }
 
 func (op *DeployOperation) resolveAndTagImageRef(imageRef string) (string, error) {
@@ -141,7 +311,10 @@ func (op *DeployOperation) resolveAndTagImageRef(imageRef string) (string, error
 
 	fmt.Println("-->", img.ID)
 
-	imageTag := newDeploymentTag(op.appConfig.AppName)
+	imageTag, err := retargetDeploymentTag(newDeploymentTag(op.appConfig.AppName), op.appConfig.Registry)
+	if err != nil {
+		return "", err
+	}
 
 	printHeader("Creating deployment tag")
 	if err := op.dockerClient.TagImage(op.ctx, img.ID, imageTag); err != nil {
@@ -152,6 +325,31 @@ func (op *DeployOperation) resolveAndTagImageRef(imageRef string) (string, error
 	return imageTag, nil
 }
 
+// retargetDeploymentTag swaps tag's registry host for reg.URL when a
+// [registry] table is configured, so a locally-built image during a
+// deploy-from-source is tagged, pushed, and deployed from the user's own
+// ECR/GCR/GHCR instead of always the Fly registry newDeploymentTag defaults
+// to. With no [registry] configured, tag is returned unchanged.
+func retargetDeploymentTag(tag string, reg *flyctl.Registry) (string, error) {
+	if reg == nil || reg.URL == "" {
+		return tag, nil
+	}
+
+	ref, err := name.ParseReference(tag)
+	if err != nil {
+		return "", fmt.Errorf("invalid deployment tag %q: %w", tag, err)
+	}
+
+	repoTag, ok := ref.(name.Tag)
+	if !ok {
+		return tag, nil
+	}
+
+	host := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(reg.URL, "https://"), "http://"), "/")
+
+	return fmt.Sprintf("%s/%s:%s", host, repoTag.RepositoryStr(), repoTag.TagStr()), nil
+}
+
 func (op *DeployOperation) pushImage(imageTag string) error {
 	printHeader("Pushing image")
 
@@ -159,7 +357,12 @@ func (op *DeployOperation) pushImage(imageTag string) error {
 		return errors.New("invalid image reference")
 	}
 
-	if err := op.dockerClient.PushImage(op.ctx, imageTag, op.out); err != nil {
+	auth, err := NewAuthResolver(op.appConfig).Resolve(registryHost(imageTag))
+	if err != nil {
+		return err
+	}
+
+	if err := op.dockerClient.PushImage(op.ctx, imageTag, auth.Username, auth.Password, op.out); err != nil {
 		return err
 	}
 	fmt.Println("-->", "done")
@@ -167,7 +370,11 @@ func (op *DeployOperation) pushImage(imageTag string) error {
 	return nil
 }
 
-func (op *DeployOperation) optimizeImage(imageTag string) error {
+// optimizeImage triggers the Fly remote image optimizer on imageTag.
+// authToken, resolved the same way as checkManifest's (see resolveAuthToken),
+// lets the optimizer pull private base images through the go-containerregistry
+// transport instead of only ever-public ones.
+func (op *DeployOperation) optimizeImage(imageTag, authToken string) error {
 	printHeader("Optimizing image")
 	defer fmt.Println("-->", "done")
 
@@ -184,7 +391,7 @@ func (op *DeployOperation) optimizeImage(imageTag string) error {
 	for {
 		select {
 		case <-time.After(delay):
-			status, err := op.apiClient.OptimizeImage(op.AppName(), imageTag)
+			status, err := op.apiClient.OptimizeImage(op.AppName(), imageTag, authToken)
 			if err != nil {
 				return err
 			}
@@ -199,13 +406,22 @@ func (op *DeployOperation) optimizeImage(imageTag string) error {
 }
 
 func (op *DeployOperation) deployImage(imageTag string) (*api.Release, error) {
-	input := api.DeployImageInput{AppID: op.AppName(), Image: imageTag}
+	image := imageTag
+	if op.multiArchRef != "" && imageTag == op.multiArchRef {
+		image = op.multiArchDigest
+	}
+
+	input := api.DeployImageInput{AppID: op.AppName(), Image: image}
 
 	if op.appConfig != nil && len(op.appConfig.Definition) > 0 {
 		x := api.Definition(op.appConfig.Definition)
 		input.Definition = &x
 	}
 
+	if len(op.stepResults) > 0 {
+		input.StepResults = op.stepResults
+	}
+
 	printHeader("Creating Release")
 	release, err := op.apiClient.DeployImage(input)
 	if err != nil {
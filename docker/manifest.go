@@ -0,0 +1,168 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/superfly/flyctl/helpers"
+)
+
+// ManifestBuilder assembles an OCI image index / Docker manifest list out of
+// per-platform images already pushed to a registry, mirroring the UX of
+// podman's `pkg/bindings/manifests` and the `podman manifest` command.
+//
+// `flyctl image manifest create/add/push` are separate CLI invocations, each
+// its own process, so the assembled state can't live only in memory — it's
+// persisted to disk under manifestStatePath(tag) between calls, the same way
+// podman keeps its manifest lists in its local containers-storage.
+type ManifestBuilder struct {
+	tag   string
+	ref   name.Tag
+	opts  []remote.Option
+	state manifestState
+}
+
+// manifestState is ManifestBuilder's on-disk representation: just the
+// platform image refs and annotations added so far. Push re-fetches each
+// image by ref rather than persisting image content itself.
+type manifestState struct {
+	ImageRefs   []string          `json:"image_refs,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// NewManifestBuilder opens (or starts tracking) the manifest list that will
+// be pushed to tag (e.g. "registry.fly.io/my-app:deployment-xyz"), loading
+// any state a prior `create`/`add` call for this tag already persisted.
+func NewManifestBuilder(tag string, opts ...remote.Option) (*ManifestBuilder, error) {
+	ref, err := name.NewTag(tag)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest tag %q: %w", tag, err)
+	}
+
+	state, err := readManifestState(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ManifestBuilder{
+		tag:   tag,
+		ref:   ref,
+		opts:  opts,
+		state: state,
+	}, nil
+}
+
+// Create resets the manifest list for this tag to empty and persists that
+// reset to disk, so a later `add`/`push` invocation starts clean.
+func (m *ManifestBuilder) Create() error {
+	m.state = manifestState{}
+	return writeManifestState(m.tag, m.state)
+}
+
+// Add records imageRef (which must already be pushed) as a member of the
+// manifest list and persists the updated state to disk.
+func (m *ManifestBuilder) Add(imageRef string) error {
+	if _, err := name.ParseReference(imageRef); err != nil {
+		return fmt.Errorf("invalid image reference %q: %w", imageRef, err)
+	}
+
+	m.state.ImageRefs = append(m.state.ImageRefs, imageRef)
+
+	return writeManifestState(m.tag, m.state)
+}
+
+// Annotate sets an annotation on the manifest list itself (e.g.
+// "com.fly.deployment" -> a release version), not on any one platform
+// image, and persists the updated state to disk.
+func (m *ManifestBuilder) Annotate(key, value string) error {
+	if m.state.Annotations == nil {
+		m.state.Annotations = map[string]string{}
+	}
+	m.state.Annotations[key] = value
+
+	return writeManifestState(m.tag, m.state)
+}
+
+// Push fetches every image ref added so far, assembles them into an image
+// index, writes it to the registry, and returns its digest, which
+// deployImage sends to the API as the deployment reference.
+func (m *ManifestBuilder) Push() (string, error) {
+	index := empty.Index
+
+	for _, imageRef := range m.state.ImageRefs {
+		ref, err := name.ParseReference(imageRef)
+		if err != nil {
+			return "", fmt.Errorf("invalid image reference %q: %w", imageRef, err)
+		}
+
+		img, err := remote.Image(ref, m.opts...)
+		if err != nil {
+			return "", fmt.Errorf("fetching %s: %w", imageRef, err)
+		}
+
+		index = mutate.AppendManifests(index, mutate.IndexAddendum{Add: img})
+	}
+
+	if len(m.state.Annotations) > 0 {
+		index = mutate.Annotations(index, m.state.Annotations).(v1.ImageIndex)
+	}
+
+	if err := remote.WriteIndex(m.ref, index, m.opts...); err != nil {
+		return "", fmt.Errorf("pushing manifest list %s: %w", m.ref, err)
+	}
+
+	digest, err := index.Digest()
+	if err != nil {
+		return "", err
+	}
+
+	return digest.String(), nil
+}
+
+// manifestStatePath returns the on-disk location tracking tag's
+// in-progress manifest list, under ~/.flyctl/manifests. Tags contain "/"
+// and ":", neither of which are safe path components, so they're replaced
+// with "_".
+func manifestStatePath(tag string) string {
+	safeName := strings.NewReplacer("/", "_", ":", "_").Replace(tag)
+	return filepath.Join(flyctlHomeDir(), ".flyctl", "manifests", safeName+".json")
+}
+
+func readManifestState(tag string) (manifestState, error) {
+	data, err := os.ReadFile(manifestStatePath(tag))
+	if os.IsNotExist(err) {
+		return manifestState{}, nil
+	} else if err != nil {
+		return manifestState{}, err
+	}
+
+	var state manifestState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return manifestState{}, fmt.Errorf("parsing manifest state for %s: %w", tag, err)
+	}
+
+	return state, nil
+}
+
+func writeManifestState(tag string, state manifestState) error {
+	path := manifestStatePath(tag)
+
+	if err := helpers.MkdirAll(path); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
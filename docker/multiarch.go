@@ -0,0 +1,103 @@
+package docker
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// buildMultiArchImage builds one image per entry in platforms using
+// BuildKit's --platform, pushes each with a platform-suffixed tag, and
+// assembles them into a single manifest list/image index pushed under the
+// deployment tag. The returned ref is already pushed to the registry, so
+// callers should deploy it directly rather than routing it back through the
+// single-platform resolve/tag/push path.
+func (op *DeployOperation) buildMultiArchImage(contextDir, dockerfilePath, target string, buildArgs map[string]string, platforms []string) (string, error) {
+	manifestTag, err := retargetDeploymentTag(newDeploymentTag(op.appConfig.AppName), op.appConfig.Registry)
+	if err != nil {
+		return "", err
+	}
+
+	auth, err := NewAuthResolver(op.appConfig).Resolve(registryHost(manifestTag))
+	if err != nil {
+		return "", err
+	}
+
+	builder, err := NewManifestBuilder(manifestTag, remote.WithAuth(auth.Authenticator()))
+	if err != nil {
+		return "", err
+	}
+	if err := builder.Create(); err != nil {
+		return "", err
+	}
+
+	for _, platform := range platforms {
+		printHeader(fmt.Sprintf("Building %s", platform))
+
+		platformTag := fmt.Sprintf("%s-%s", manifestTag, strings.ReplaceAll(platform, "/", "-"))
+
+		if err := op.buildAndPushWithBuildKit(contextDir, dockerfilePath, platformTag, target, platform, buildArgs); err != nil {
+			return "", fmt.Errorf("building %s: %w", platform, err)
+		}
+
+		if err := builder.Add(platformTag); err != nil {
+			return "", err
+		}
+
+		fmt.Println("-->", platformTag)
+	}
+
+	printHeader("Pushing manifest list")
+
+	digest, err := builder.Push()
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Println("-->", digest)
+
+	op.multiArchRef = manifestTag
+	op.multiArchDigest = digest
+
+	return manifestTag, nil
+}
+
+// buildAndPushWithBuildKit is buildWithBuildKit extended with a --platform
+// flag and a registry push output, used to build and publish one arch of a
+// multi-arch image.
+func (op *DeployOperation) buildAndPushWithBuildKit(contextDir, dockerfilePath, imageTag, target, platform string, buildArgs map[string]string) error {
+	args := []string{
+		"build",
+		"--frontend", "dockerfile.v0",
+		"--local", "context=" + contextDir,
+		"--local", "dockerfile=" + filepath.Join(contextDir, filepath.Dir(dockerfilePath)),
+		"--opt", "platform=" + platform,
+		"--output", fmt.Sprintf("type=image,name=%s,push=true", imageTag),
+	}
+
+	if target != "" {
+		args = append(args, "--opt", "target="+target)
+	}
+	if op.appConfig.Build != nil && op.appConfig.Build.CacheFrom != "" {
+		args = append(args, "--import-cache", "type=registry,ref="+op.appConfig.Build.CacheFrom)
+	}
+	if op.appConfig.Build != nil && op.appConfig.Build.CacheTo != "" {
+		args = append(args, "--export-cache", "type=registry,ref="+op.appConfig.Build.CacheTo)
+	}
+	for k, v := range buildArgs {
+		args = append(args, "--opt", fmt.Sprintf("build-arg:%s=%s", k, v))
+	}
+
+	cmd := exec.CommandContext(op.ctx, "buildctl", args...)
+	cmd.Stdout = op.out
+	cmd.Stderr = op.out
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("buildctl build failed: %w", err)
+	}
+
+	return nil
+}
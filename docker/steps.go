@@ -0,0 +1,85 @@
+package docker
+
+import (
+	"fmt"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/flyctl"
+)
+
+// RunSteps runs every deploy.steps entry whose When matches phase ("pre",
+// "release", or "post"), in declaration order, against a one-shot Fly
+// machine built from the step's own image or, if it doesn't set one,
+// imageRef. Each step's logs are streamed through op.out and its result
+// appended to op.stepResults, which deployImage sends with the release; the
+// first step that exits non-zero stops the run and is returned as an error.
+// Only steps that ran and succeeded before deployImage reach the release:
+// "post" steps run after it, and a failing "pre"/"release" step stops the
+// deploy before it, so neither result is sent.
+func (op *DeployOperation) RunSteps(phase, imageRef string) error {
+	if op.appConfig == nil || op.appConfig.Deploy == nil {
+		return nil
+	}
+
+	for _, step := range op.appConfig.Deploy.Steps {
+		if step.When != phase {
+			continue
+		}
+
+		printHeader(fmt.Sprintf("Running %s step %q", phase, step.Name))
+
+		image := step.Image
+		if image == "" {
+			image = imageRef
+		}
+
+		result, err := op.runStepMachine(step, image)
+		op.stepResults = append(op.stepResults, result)
+
+		if err != nil {
+			return fmt.Errorf("%s step %q failed: %w", phase, step.Name, err)
+		}
+
+		fmt.Println("-->", "done")
+	}
+
+	return nil
+}
+
+// runStepMachine creates a one-shot Fly machine for step, streams its logs
+// through op.out, and waits for it to exit.
+func (op *DeployOperation) runStepMachine(step flyctl.DeployStep, image string) (*api.ReleaseStepResult, error) {
+	machine, err := op.apiClient.CreateOneShotMachine(op.AppName(), api.MachineConfig{
+		Image:   image,
+		Command: step.Command,
+		Env:     step.Env,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logs, err := op.apiClient.StreamMachineLogs(op.ctx, machine.ID)
+	if err != nil {
+		return nil, err
+	}
+	for line := range logs {
+		fmt.Fprintln(op.out, line)
+	}
+
+	exit, err := op.apiClient.WaitForMachineExit(op.ctx, machine.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &api.ReleaseStepResult{
+		Name:     step.Name,
+		When:     step.When,
+		ExitCode: exit.ExitCode,
+	}
+
+	if exit.ExitCode != 0 {
+		return result, fmt.Errorf("exited with code %d", exit.ExitCode)
+	}
+
+	return result, nil
+}
@@ -6,11 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 
 	"github.com/BurntSushi/toml"
+	"github.com/ghodss/yaml"
 	"github.com/superfly/flyctl/helpers"
 )
 
@@ -18,19 +20,84 @@ type ConfigFormat string
 
 const (
 	TOMLFormat        ConfigFormat = ".toml"
+	JSONFormat        ConfigFormat = ".json"
+	YAMLFormat        ConfigFormat = ".yaml"
 	UnsupportedFormat              = ""
 )
 
+// defaultConfigFileNames lists the file names ResolveConfigFileFromPath
+// looks for, in order of preference, when given a directory rather than a
+// file.
+var defaultConfigFileNames = []string{"fly.toml", "fly.yaml", "fly.json"}
+
 type AppConfig struct {
-	AppName string
-	Build   *Build
+	AppName  string
+	Build    *Build
+	Deploy   *Deploy
+	Registry *Registry
 
 	Definition map[string]interface{}
+
+	// originalBytes holds the raw, unexpanded config file contents when the
+	// config was loaded from disk with variable substitution enabled, so
+	// marshalTOML can round-trip the template instead of baking resolved
+	// secrets back into the file. originalFormat records which format those
+	// bytes are in, so a marshal* for a different format (e.g. `config
+	// convert --to yaml` on a fly.toml) doesn't write them back verbatim.
+	originalBytes  []byte
+	originalFormat ConfigFormat
 }
 
 type Build struct {
 	Builder string
 	Args    map[string]string
+
+	// Strategy selects how the image is produced: "local" builds with the
+	// local Docker/BuildKit daemon, "remote" always uses the Fly remote
+	// builder, and "auto" (the default) prefers local when a daemon is
+	// available. Overridable per-deploy with --local-only/--remote-only.
+	Strategy string
+
+	// Target is passed through as the Dockerfile build target (--target).
+	Target string
+
+	// CacheFrom/CacheTo configure BuildKit's --cache-from/--cache-to.
+	CacheFrom string
+	CacheTo   string
+
+	// Platforms, when set to more than one entry (e.g. "linux/amd64",
+	// "linux/arm64"), causes the deploy to build one image per platform and
+	// assemble them into a multi-arch manifest list/image index.
+	Platforms []string
+}
+
+// Deploy holds the [deploy] table, currently just the ordered list of
+// one-shot steps run around a deploy (see [[deploy.steps]]).
+type Deploy struct {
+	Steps []DeployStep
+}
+
+// DeployStep is one [[deploy.steps]] entry: a one-shot machine run at a
+// given point in the deploy. When is "pre" (before the release is created),
+// "release" (e.g. a database migration that must succeed before rollout),
+// or "post" (after the release is live).
+type DeployStep struct {
+	Name    string
+	Image   string
+	Command []string
+	When    string
+	Env     map[string]string
+}
+
+// Registry holds the [registry] table, letting deploys push build
+// artifacts somewhere other than the Fly registry. Credentials are read
+// from the named environment variables rather than stored in fly.toml
+// itself.
+type Registry struct {
+	URL              string
+	Username         string
+	PasswordEnv      string
+	IdentityTokenEnv string
 }
 
 func NewAppConfig() *AppConfig {
@@ -39,7 +106,11 @@ func NewAppConfig() *AppConfig {
 	}
 }
 
-func LoadAppConfig(configFile string) (*AppConfig, error) {
+// LoadAppConfig reads and parses the config file at configFile. vars
+// resolves "${VAR}" references in the raw config text before it's decoded
+// (see unmarshalTOML); it's populated from "--var KEY=VALUE" flags and may
+// be nil to fall back to the process environment only.
+func LoadAppConfig(configFile string, vars map[string]string) (*AppConfig, error) {
 	fullConfigFilePath, err := filepath.Abs(configFile)
 	if err != nil {
 		return nil, err
@@ -57,7 +128,11 @@ func LoadAppConfig(configFile string) (*AppConfig, error) {
 
 	switch ConfigFormatFromPath(fullConfigFilePath) {
 	case TOMLFormat:
-		err = appConfig.unmarshalTOML(file)
+		err = appConfig.unmarshalTOML(file, vars)
+	case JSONFormat:
+		err = appConfig.unmarshalJSON(file, vars)
+	case YAMLFormat:
+		err = appConfig.unmarshalYAML(file, vars)
 	default:
 		return nil, errors.New("Unsupported config file format")
 	}
@@ -73,15 +148,86 @@ func (ac *AppConfig) WriteTo(w io.Writer, format ConfigFormat) error {
 	switch format {
 	case TOMLFormat:
 		return ac.marshalTOML(w)
+	case JSONFormat:
+		return ac.marshalJSON(w)
+	case YAMLFormat:
+		return ac.marshalYAML(w)
 	}
 
 	return fmt.Errorf("Unsupported format: %s", format)
 }
 
-func (ac *AppConfig) unmarshalTOML(r io.Reader) error {
+// unmarshalTOML decodes TOML config text read from r. Before decoding, the
+// raw text is run through envsubst-style variable interpolation ("${VAR}",
+// "${VAR:-default}", "${VAR-default}", "${VAR:?message}", with "$$" escaping
+// to a literal "$"), resolved first from vars and then from os.Environ(). The
+// raw, unexpanded bytes are kept on ac so marshalTOML can write the template
+// back out unchanged rather than baking resolved values into the file.
+func (ac *AppConfig) unmarshalTOML(r io.Reader, vars map[string]string) error {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	ac.originalBytes = raw
+	ac.originalFormat = TOMLFormat
+
+	expanded, err := interpolateConfig(string(raw), vars)
+	if err != nil {
+		return err
+	}
+
+	var data map[string]interface{}
+
+	if _, err := toml.Decode(expanded, &data); err != nil {
+		return err
+	}
+
+	return ac.unmarshalNativeMap(data)
+}
+
+// unmarshalJSON decodes JSON config text read from r, applying the same
+// variable interpolation pass as unmarshalTOML before decoding.
+func (ac *AppConfig) unmarshalJSON(r io.Reader, vars map[string]string) error {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	ac.originalBytes = raw
+	ac.originalFormat = JSONFormat
+
+	expanded, err := interpolateConfig(string(raw), vars)
+	if err != nil {
+		return err
+	}
+
 	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(expanded), &data); err != nil {
+		return err
+	}
 
-	if _, err := toml.DecodeReader(r, &data); err != nil {
+	return ac.unmarshalNativeMap(data)
+}
+
+// unmarshalYAML decodes YAML config text read from r, applying the same
+// variable interpolation pass as unmarshalTOML before decoding. It goes
+// through ghodss/yaml so nested maps come out as map[string]interface{}
+// (rather than map[interface{}]interface{}), matching what
+// unmarshalNativeMap and the JSON round-trip in marshalTOML expect.
+func (ac *AppConfig) unmarshalYAML(r io.Reader, vars map[string]string) error {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	ac.originalBytes = raw
+	ac.originalFormat = YAMLFormat
+
+	expanded, err := interpolateConfig(string(raw), vars)
+	if err != nil {
+		return err
+	}
+
+	var data map[string]interface{}
+	if err := yaml.Unmarshal([]byte(expanded), &data); err != nil {
 		return err
 	}
 
@@ -99,45 +245,271 @@ func (ac *AppConfig) unmarshalNativeMap(data map[string]interface{}) error {
 			Args: map[string]string{},
 		}
 		for k, v := range buildConfig {
-			if k == "builder" {
+			switch k {
+			case "builder":
 				b.Builder = fmt.Sprint(v)
-			} else if k == "args" {
+			case "strategy":
+				b.Strategy = fmt.Sprint(v)
+			case "target":
+				b.Target = fmt.Sprint(v)
+			case "cache_from":
+				b.CacheFrom = fmt.Sprint(v)
+			case "cache_to":
+				b.CacheTo = fmt.Sprint(v)
+			case "platforms":
+				if platforms, ok := v.([]interface{}); ok {
+					for _, p := range platforms {
+						b.Platforms = append(b.Platforms, fmt.Sprint(p))
+					}
+				}
+			case "args":
 				if argMap, ok := v.(map[string]interface{}); ok {
 					for argK, argV := range argMap {
 						b.Args[argK] = fmt.Sprint(argV)
 					}
 				}
-			} else {
+			default:
 				b.Args[k] = fmt.Sprint(v)
 			}
 		}
-		if b.Builder != "" {
+		if b.Builder != "" || b.Strategy != "" || b.Target != "" || b.CacheFrom != "" || b.CacheTo != "" ||
+			len(b.Args) > 0 || len(b.Platforms) > 0 {
 			ac.Build = &b
 		}
 	}
 	delete(data, "build")
 
+	if deployConfig, ok := (data["deploy"]).(map[string]interface{}); ok {
+		d := Deploy{}
+		if rawSteps, ok := deployConfig["steps"].([]map[string]interface{}); ok {
+			for _, rawStep := range rawSteps {
+				step, err := parseDeployStep(rawStep)
+				if err != nil {
+					return err
+				}
+				d.Steps = append(d.Steps, step)
+			}
+		} else if rawSteps, ok := deployConfig["steps"].([]interface{}); ok {
+			for _, rs := range rawSteps {
+				if stepMap, ok := rs.(map[string]interface{}); ok {
+					step, err := parseDeployStep(stepMap)
+					if err != nil {
+						return err
+					}
+					d.Steps = append(d.Steps, step)
+				}
+			}
+		}
+		if len(d.Steps) > 0 {
+			ac.Deploy = &d
+		}
+	}
+	delete(data, "deploy")
+
+	if registryConfig, ok := (data["registry"]).(map[string]interface{}); ok {
+		r := Registry{}
+		if v, ok := registryConfig["url"]; ok {
+			r.URL = fmt.Sprint(v)
+		}
+		if v, ok := registryConfig["username"]; ok {
+			r.Username = fmt.Sprint(v)
+		}
+		if v, ok := registryConfig["password_env"]; ok {
+			r.PasswordEnv = fmt.Sprint(v)
+		}
+		if v, ok := registryConfig["identity_token_env"]; ok {
+			r.IdentityTokenEnv = fmt.Sprint(v)
+		}
+		if r.URL != "" {
+			ac.Registry = &r
+		}
+	}
+	delete(data, "registry")
+
 	ac.Definition = data
 
 	return nil
 }
 
+// validDeployStepWhens are the only values accepted for a [[deploy.steps]]
+// entry's "when", matching the points flyctl's deploy pipeline actually
+// invokes steps at.
+var validDeployStepWhens = map[string]bool{
+	"pre":     true,
+	"release": true,
+	"post":    true,
+}
+
+func parseDeployStep(raw map[string]interface{}) (DeployStep, error) {
+	step := DeployStep{
+		Env: map[string]string{},
+	}
+
+	if v, ok := raw["name"]; ok {
+		step.Name = fmt.Sprint(v)
+	}
+	if v, ok := raw["image"]; ok {
+		step.Image = fmt.Sprint(v)
+	}
+	if v, ok := raw["when"]; ok {
+		step.When = fmt.Sprint(v)
+	}
+	if !validDeployStepWhens[step.When] {
+		return DeployStep{}, fmt.Errorf("invalid deploy step when %q, expected \"pre\", \"release\", or \"post\"", step.When)
+	}
+	if cmd, ok := raw["command"].([]interface{}); ok {
+		for _, c := range cmd {
+			step.Command = append(step.Command, fmt.Sprint(c))
+		}
+	}
+	if env, ok := raw["env"].(map[string]interface{}); ok {
+		for k, v := range env {
+			step.Env[k] = fmt.Sprint(v)
+		}
+	}
+
+	return step, nil
+}
+
+// buildData renders ac.Build as the plain map stored under the "build"
+// key, or nil if there's nothing to emit.
+func (ac AppConfig) buildData() map[string]interface{} {
+	if ac.Build == nil || (ac.Build.Builder == "" && ac.Build.Strategy == "" &&
+		ac.Build.Target == "" && ac.Build.CacheFrom == "" && ac.Build.CacheTo == "" &&
+		len(ac.Build.Platforms) == 0 && len(ac.Build.Args) == 0) {
+		return nil
+	}
+
+	buildData := map[string]interface{}{}
+	if ac.Build.Builder != "" {
+		buildData["builder"] = ac.Build.Builder
+	}
+	if ac.Build.Strategy != "" {
+		buildData["strategy"] = ac.Build.Strategy
+	}
+	if ac.Build.Target != "" {
+		buildData["target"] = ac.Build.Target
+	}
+	if ac.Build.CacheFrom != "" {
+		buildData["cache_from"] = ac.Build.CacheFrom
+	}
+	if ac.Build.CacheTo != "" {
+		buildData["cache_to"] = ac.Build.CacheTo
+	}
+	if len(ac.Build.Platforms) > 0 {
+		buildData["platforms"] = ac.Build.Platforms
+	}
+	if len(ac.Build.Args) > 0 {
+		buildData["args"] = ac.Build.Args
+	}
+
+	return buildData
+}
+
+// deployData renders ac.Deploy as the plain map stored under the "deploy"
+// key, or nil if there are no steps to emit.
+func (ac AppConfig) deployData() map[string]interface{} {
+	if ac.Deploy == nil || len(ac.Deploy.Steps) == 0 {
+		return nil
+	}
+
+	steps := make([]map[string]interface{}, 0, len(ac.Deploy.Steps))
+	for _, step := range ac.Deploy.Steps {
+		s := map[string]interface{}{
+			"name": step.Name,
+			"when": step.When,
+		}
+		if step.Image != "" {
+			s["image"] = step.Image
+		}
+		if len(step.Command) > 0 {
+			s["command"] = step.Command
+		}
+		if len(step.Env) > 0 {
+			s["env"] = step.Env
+		}
+		steps = append(steps, s)
+	}
+
+	return map[string]interface{}{"steps": steps}
+}
+
+// registryData renders ac.Registry as the plain map stored under the
+// "registry" key, or nil if there's nothing to emit.
+func (ac AppConfig) registryData() map[string]interface{} {
+	if ac.Registry == nil || ac.Registry.URL == "" {
+		return nil
+	}
+
+	r := map[string]interface{}{
+		"url": ac.Registry.URL,
+	}
+	if ac.Registry.Username != "" {
+		r["username"] = ac.Registry.Username
+	}
+	if ac.Registry.PasswordEnv != "" {
+		r["password_env"] = ac.Registry.PasswordEnv
+	}
+	if ac.Registry.IdentityTokenEnv != "" {
+		r["identity_token_env"] = ac.Registry.IdentityTokenEnv
+	}
+
+	return r
+}
+
+// rawData assembles the full config as a plain map — "app", "build",
+// "deploy", "registry", and the remaining top-level keys held in
+// ac.Definition — for formats that encode the whole document in a single
+// pass (unlike marshalTOML, which encodes "app"/"build"/"deploy"/"registry"
+// and the definition separately to control numeric types).
+func (ac AppConfig) rawData() map[string]interface{} {
+	rawData := map[string]interface{}{
+		"app": ac.AppName,
+	}
+
+	if buildData := ac.buildData(); buildData != nil {
+		rawData["build"] = buildData
+	}
+	if deployData := ac.deployData(); deployData != nil {
+		rawData["deploy"] = deployData
+	}
+	if registryData := ac.registryData(); registryData != nil {
+		rawData["registry"] = registryData
+	}
+
+	for k, v := range ac.Definition {
+		rawData[k] = v
+	}
+
+	return rawData
+}
+
 func (ac AppConfig) marshalTOML(w io.Writer) error {
+	// If the config was loaded from disk with substitution enabled, write
+	// back the original unexpanded template so `config save` doesn't bake
+	// secrets/environment-specific values into the repo. This only applies
+	// when we're writing back out in the same format it was read in —
+	// `config convert` to a different format must always re-encode.
+	if len(ac.originalBytes) > 0 && ac.originalFormat == TOMLFormat {
+		_, err := w.Write(ac.originalBytes)
+		return err
+	}
+
 	encoder := toml.NewEncoder(w)
 
 	rawData := map[string]interface{}{
 		"app": ac.AppName,
 	}
 
-	if ac.Build != nil && ac.Build.Builder != "" {
-		buildData := map[string]interface{}{
-			"builder": ac.Build.Builder,
-		}
-		if len(ac.Build.Args) > 0 {
-			buildData["args"] = ac.Build.Args
-		}
+	if buildData := ac.buildData(); buildData != nil {
 		rawData["build"] = buildData
 	}
+	if deployData := ac.deployData(); deployData != nil {
+		rawData["deploy"] = deployData
+	}
+	if registryData := ac.registryData(); registryData != nil {
+		rawData["registry"] = registryData
+	}
 
 	if err := encoder.Encode(rawData); err != nil {
 		return err
@@ -161,6 +533,38 @@ func (ac AppConfig) marshalTOML(w io.Writer) error {
 	return nil
 }
 
+func (ac AppConfig) marshalJSON(w io.Writer) error {
+	// See marshalTOML: only short-circuit when the original bytes are
+	// themselves JSON, otherwise `config convert --to json` from a fly.toml
+	// would write raw TOML text into a .json file.
+	if len(ac.originalBytes) > 0 && ac.originalFormat == JSONFormat {
+		_, err := w.Write(ac.originalBytes)
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(ac.rawData())
+}
+
+func (ac AppConfig) marshalYAML(w io.Writer) error {
+	// See marshalTOML: only short-circuit when the original bytes are
+	// themselves YAML, otherwise `config convert --to yaml` from a fly.toml
+	// would write raw TOML text into a .yaml file.
+	if len(ac.originalBytes) > 0 && ac.originalFormat == YAMLFormat {
+		_, err := w.Write(ac.originalBytes)
+		return err
+	}
+
+	out, err := yaml.Marshal(ac.rawData())
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(out)
+	return err
+}
+
 func (ac *AppConfig) WriteToFile(filename string) error {
 	if err := helpers.MkdirAll(filename); err != nil {
 		return err
@@ -175,8 +579,11 @@ func (ac *AppConfig) WriteToFile(filename string) error {
 	return ac.WriteTo(file, ConfigFormatFromPath(filename))
 }
 
-const defaultConfigFileName = "fly.toml"
-
+// ResolveConfigFileFromPath resolves p to a config file path. If p already
+// names a file (has an extension), it's returned as-is. Otherwise p is
+// treated as a directory and each name in defaultConfigFileNames is tried in
+// order, returning the first one that exists; if none exist, the first
+// candidate (fly.toml) is returned so callers can create it.
 func ResolveConfigFileFromPath(p string) (string, error) {
 	p, err := filepath.Abs(p)
 	if err != nil {
@@ -188,13 +595,24 @@ func ResolveConfigFileFromPath(p string) (string, error) {
 		return p, nil
 	}
 
-	return path.Join(p, defaultConfigFileName), nil
+	for _, name := range defaultConfigFileNames {
+		candidate := path.Join(p, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+
+	return path.Join(p, defaultConfigFileNames[0]), nil
 }
 
 func ConfigFormatFromPath(p string) ConfigFormat {
 	switch path.Ext(p) {
 	case ".toml":
 		return TOMLFormat
+	case ".json":
+		return JSONFormat
+	case ".yaml", ".yml":
+		return YAMLFormat
 	}
 	return UnsupportedFormat
 }
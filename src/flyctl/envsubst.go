@@ -0,0 +1,122 @@
+package flyctl
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// UnresolvedVarError is returned when one or more required variables
+// (declared with the "${VAR:?message}" form) could not be resolved during
+// interpolation. It collects every missing variable so the caller can report
+// them all at once instead of failing on the first one encountered.
+type UnresolvedVarError struct {
+	Vars []string
+}
+
+func (e *UnresolvedVarError) Error() string {
+	return fmt.Sprintf("unresolved required variable(s): %s", strings.Join(e.Vars, ", "))
+}
+
+var interpolationPattern = regexp.MustCompile(`\$\$|\$\{[^}]*\}|\$[A-Za-z_][A-Za-z0-9_]*`)
+
+// interpolate expands shell-style "${VAR}", "${VAR:-default}",
+// "${VAR-default}", and "${VAR:?message}" references found in src, resolving
+// variable values with lookup. "$$" is treated as an escaped literal "$".
+// Any required variable that lookup can't resolve is collected and returned
+// together as a single *UnresolvedVarError.
+func interpolate(src string, lookup func(string) (string, bool)) (string, error) {
+	var missing []string
+
+	result := interpolationPattern.ReplaceAllStringFunc(src, func(match string) string {
+		if match == "$$" {
+			return "$"
+		}
+
+		if strings.HasPrefix(match, "${") {
+			expr := match[2 : len(match)-1]
+			val, unresolved := resolveExpr(expr, lookup)
+			if unresolved != "" {
+				missing = append(missing, unresolved)
+			}
+			return val
+		}
+
+		// bare "$VAR" form, no operators supported
+		name := match[1:]
+		val, _ := lookup(name)
+		return val
+	})
+
+	if len(missing) > 0 {
+		return "", &UnresolvedVarError{Vars: missing}
+	}
+
+	return result, nil
+}
+
+// resolveExpr resolves the body of a "${...}" reference, supporting three
+// shell-style operators: "VAR:-default" (default if VAR is unset or empty),
+// "VAR-default" (default only if VAR is unset, even if it's set to ""), and
+// "VAR:?message" (error if VAR is unset or empty). It returns the resolved
+// value, or (if the variable is required via ":?" and unresolved) an empty
+// value plus a description of the unresolved variable.
+func resolveExpr(expr string, lookup func(string) (string, bool)) (value string, unresolved string) {
+	name, op, arg := expr, "", ""
+
+	switch {
+	case strings.Contains(expr, ":-"):
+		i := strings.Index(expr, ":-")
+		name, op, arg = expr[:i], ":-", expr[i+2:]
+	case strings.Contains(expr, ":?"):
+		i := strings.Index(expr, ":?")
+		name, op, arg = expr[:i], ":?", expr[i+2:]
+	case strings.Contains(expr, "-"):
+		i := strings.Index(expr, "-")
+		name, op, arg = expr[:i], "-", expr[i+1:]
+	}
+
+	val, ok := lookup(name)
+
+	switch op {
+	case ":-":
+		if !ok || val == "" {
+			return arg, ""
+		}
+		return val, ""
+	case "-":
+		if !ok {
+			return arg, ""
+		}
+		return val, ""
+	case ":?":
+		if ok && val != "" {
+			return val, ""
+		}
+		msg := arg
+		if msg == "" {
+			msg = "not set"
+		}
+		return "", fmt.Sprintf("%s (%s)", name, msg)
+	default:
+		if ok {
+			return val, ""
+		}
+		return "", ""
+	}
+}
+
+// interpolateConfig runs interpolate against raw config text, resolving
+// variables first from vars (populated from "--var KEY=VALUE" flags) and
+// falling back to the process environment.
+func interpolateConfig(src string, vars map[string]string) (string, error) {
+	lookup := func(name string) (string, bool) {
+		if v, ok := vars[name]; ok {
+			return v, true
+		}
+		return os.LookupEnv(name)
+	}
+
+	return interpolate(src, lookup)
+}
@@ -0,0 +1,169 @@
+package flyctl
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	lookup := func(vars map[string]string) func(string) (string, bool) {
+		return func(name string) (string, bool) {
+			v, ok := vars[name]
+			return v, ok
+		}
+	}
+
+	cases := []struct {
+		name    string
+		src     string
+		vars    map[string]string
+		want    string
+		wantErr []string
+	}{
+		{
+			name: "braced variable",
+			src:  "app = \"${NAME}\"",
+			vars: map[string]string{"NAME": "hello"},
+			want: "app = \"hello\"",
+		},
+		{
+			name: "bare variable",
+			src:  "app = \"$NAME\"",
+			vars: map[string]string{"NAME": "hello"},
+			want: "app = \"hello\"",
+		},
+		{
+			name: "dollar escape",
+			src:  "price = \"$$5\"",
+			vars: map[string]string{},
+			want: "price = \"$5\"",
+		},
+		{
+			name: "default used when unset",
+			src:  "region = \"${REGION:-sea}\"",
+			vars: map[string]string{},
+			want: "region = \"sea\"",
+		},
+		{
+			name: "default ignored when set",
+			src:  "region = \"${REGION:-sea}\"",
+			vars: map[string]string{"REGION": "iad"},
+			want: "region = \"iad\"",
+		},
+		{
+			name: "colon-dash default also applies when set but empty",
+			src:  "region = \"${REGION:-sea}\"",
+			vars: map[string]string{"REGION": ""},
+			want: "region = \"sea\"",
+		},
+		{
+			name: "bare-dash default used when unset",
+			src:  "region = \"${REGION-sea}\"",
+			vars: map[string]string{},
+			want: "region = \"sea\"",
+		},
+		{
+			name: "bare-dash default NOT applied when set but empty",
+			src:  "region = \"${REGION-sea}\"",
+			vars: map[string]string{"REGION": ""},
+			want: "region = \"\"",
+		},
+		{
+			name: "bare-dash ignored when set to a value",
+			src:  "region = \"${REGION-sea}\"",
+			vars: map[string]string{"REGION": "iad"},
+			want: "region = \"iad\"",
+		},
+		{
+			name: "required present",
+			src:  "secret = \"${SECRET:?must be set}\"",
+			vars: map[string]string{"SECRET": "shh"},
+			want: "secret = \"shh\"",
+		},
+		{
+			name:    "required missing",
+			src:     "secret = \"${SECRET:?must be set}\"",
+			vars:    map[string]string{},
+			wantErr: []string{"SECRET (must be set)"},
+		},
+		{
+			name:    "required missing with no message",
+			src:     "secret = \"${SECRET:?}\"",
+			vars:    map[string]string{},
+			wantErr: []string{"SECRET (not set)"},
+		},
+		{
+			name:    "multiple unresolved required variables aggregate",
+			src:     "a = \"${A:?a missing}\"\nb = \"${B:?b missing}\"",
+			vars:    map[string]string{},
+			wantErr: []string{"A (a missing)", "B (b missing)"},
+		},
+		{
+			name: "unset without operator resolves empty",
+			src:  "app = \"${MISSING}\"",
+			vars: map[string]string{},
+			want: "app = \"\"",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := interpolate(tc.src, lookup(tc.vars))
+
+			if tc.wantErr != nil {
+				var unresolved *UnresolvedVarError
+				if !errors.As(err, &unresolved) {
+					t.Fatalf("expected *UnresolvedVarError, got %v", err)
+				}
+				if len(unresolved.Vars) != len(tc.wantErr) {
+					t.Fatalf("got vars %v, want %v", unresolved.Vars, tc.wantErr)
+				}
+				for i, v := range tc.wantErr {
+					if unresolved.Vars[i] != v {
+						t.Errorf("vars[%d] = %q, want %q", i, unresolved.Vars[i], v)
+					}
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInterpolateConfigFallsBackToEnviron(t *testing.T) {
+	t.Setenv("FLYCTL_ENVSUBST_TEST_VAR", "from-environ")
+
+	got, err := interpolateConfig("app = \"${FLYCTL_ENVSUBST_TEST_VAR}\"", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "app = \"from-environ\""; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestInterpolateConfigVarsTakePrecedenceOverEnviron(t *testing.T) {
+	t.Setenv("FLYCTL_ENVSUBST_TEST_VAR", "from-environ")
+
+	got, err := interpolateConfig(
+		"app = \"${FLYCTL_ENVSUBST_TEST_VAR}\"",
+		map[string]string{"FLYCTL_ENVSUBST_TEST_VAR": "from-vars"},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "app = \"from-vars\""; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if os.Getenv("FLYCTL_ENVSUBST_TEST_VAR") != "from-environ" {
+		t.Fatalf("test corrupted its own environment")
+	}
+}